@@ -17,20 +17,98 @@ type StateListCommand struct {
 	StateMeta
 }
 
+// stateListAttrFlags collects one or more repeated "-attr" flag values.
+type stateListAttrFlags []string
+
+func (f *stateListAttrFlags) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stateListAttrFlags) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+// stateListRecord is the structured form of a single "terraform state
+// list" result, used by the "-json" and "-jsonl" output modes.
+type stateListRecord struct {
+	Address       string                 `json:"address"`
+	Module        string                 `json:"module,omitempty"`
+	Mode          string                 `json:"mode"`
+	Type          string                 `json:"type"`
+	Name          string                 `json:"name"`
+	Index         interface{}            `json:"index,omitempty"`
+	Provider      string                 `json:"provider,omitempty"`
+	SchemaVersion uint64                 `json:"schema_version"`
+	Attributes    map[string]interface{} `json:"attributes"`
+}
+
+// newStateListRecord builds the structured record for a single filter
+// result, always including "id" plus any paths requested with "-attr".
+func newStateListRecord(result *terraform.StateFilterResult, extraAttrs []string) stateListRecord {
+	record := stateListRecord{Address: result.Address}
+	record.Attributes = make(map[string]interface{})
+
+	if mod := result.ModuleAddr(); !mod.IsRoot() {
+		record.Module = mod.String()
+	}
+
+	if r, ok := result.Resource(); ok {
+		record.Mode = r.Addr.Mode.String()
+		record.Type = r.Addr.Type
+		record.Name = r.Addr.Name
+	}
+	if key, ok := result.InstanceKey(); ok && key != nil {
+		record.Index = key
+	}
+	if pc, ok := result.ProviderConfig(); ok {
+		record.Provider = pc.String()
+	}
+	if v, ok := result.SchemaVersion(); ok {
+		record.SchemaVersion = v
+	}
+
+	// Decode the current attributes once and look up every requested path
+	// against the same map, rather than letting each Attr call re-decode
+	// AttrsJSON from scratch.
+	attrs, _ := result.Attrs()
+	if id, ok := terraform.LookupAttr(attrs, "id"); ok {
+		record.Attributes["id"] = id
+	}
+	for _, path := range extraAttrs {
+		if v, ok := terraform.LookupAttr(attrs, path); ok {
+			record.Attributes[path] = v
+		}
+	}
+
+	return record
+}
+
 func (c *StateListCommand) Run(args []string) int {
 	args, err := c.Meta.process(args, true)
 	if err != nil {
 		return 1
 	}
 
+	var jsonOutput, jsonlOutput bool
+	var attrFlags stateListAttrFlags
+
 	cmdFlags := c.Meta.flagSet("state list")
 	cmdFlags.StringVar(&c.Meta.statePath, "state", DefaultStateFilename, "path")
 	lookupId := cmdFlags.String("id", "", "Restrict output to paths with a resource having the specified ID.")
+	cmdFlags.BoolVar(&jsonOutput, "json", false, "Print results as a JSON array of objects, one per resource.")
+	cmdFlags.BoolVar(&jsonlOutput, "jsonl", false, "Print results as newline-delimited JSON, one object per resource.")
+	cmdFlags.Var(&attrFlags, "attr", "Include the named attribute path in JSON output. May be repeated.")
 	if err := cmdFlags.Parse(args); err != nil {
 		return cli.RunResultHelp
 	}
 	args = cmdFlags.Args()
 
+	if jsonOutput && jsonlOutput {
+		c.Ui.Error("The -json and -jsonl flags are mutually exclusive.")
+		return cli.RunResultHelp
+	}
+
 	// Load the backend
 	b, backendDiags := c.Backend(nil)
 	if backendDiags.HasErrors() {
@@ -58,35 +136,76 @@ func (c *StateListCommand) Run(args []string) int {
 	}
 
 	filter := &terraform.StateFilter{State: stateReal}
-	results, err := filter.Filter(args...)
-	if err != nil {
-		c.Ui.Error(fmt.Sprintf(errStateFilter, err))
-		return cli.RunResultHelp
+
+	// "-id" restricts the results to resources with the given ID, in
+	// addition to whatever the pattern arguments already matched. This is
+	// applied as a post-filter against the sidecar id-index, rather than
+	// spliced into the pattern text, so that it composes with any pattern
+	// shape -- an instance key range, an existing "[?...]" predicate, or a
+	// bare module address -- without having to re-derive where in the
+	// pattern text it's safe to insert.
+	var results []*terraform.StateFilterResult
+	switch {
+	case *lookupId != "" && len(args) == 0:
+		results = filter.ResultsWithID(*lookupId)
+
+	case *lookupId != "":
+		matched, err := filter.Filter(args...)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf(errStateFilter, err))
+			return cli.RunResultHelp
+		}
+		byAddress := make(map[string]bool)
+		for _, r := range filter.ResultsWithID(*lookupId) {
+			byAddress[r.Address] = true
+		}
+		for _, result := range matched {
+			if byAddress[result.Address] {
+				results = append(results, result)
+			}
+		}
+
+	default:
+		var err error
+		results, err = filter.Filter(args...)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf(errStateFilter, err))
+			return cli.RunResultHelp
+		}
 	}
 
-	for _, result := range results {
-		if is, ok := result.Value.(*states.ResourceInstance); ok {
-			// If we search a specific ID, we need to unmarshal the
-			// attributes and match the ID from the resource.
-			if *lookupId != "" {
-				id := ""
-				if is.HasCurrent() {
-					attrs := make(map[string]interface{})
-					err = json.Unmarshal(is.Current.AttrsJSON, &attrs)
-					if err != nil {
-						c.Ui.Error(fmt.Sprintf("Failed to load attribute: %s", err))
-						return 1
-					}
-					id, _ = attrs["id"].(string)
-				}
+	switch {
+	case jsonOutput:
+		records := make([]stateListRecord, 0, len(results))
+		for _, result := range results {
+			if _, ok := result.Value.(*states.ResourceInstance); ok {
+				records = append(records, newStateListRecord(result, attrFlags))
+			}
+		}
+		out, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Failed to marshal results: %s", err))
+			return 1
+		}
+		c.Ui.Output(string(out))
 
-				// Continue if the ID's don't match.
-				if *lookupId != id {
-					continue
+	case jsonlOutput:
+		for _, result := range results {
+			if _, ok := result.Value.(*states.ResourceInstance); ok {
+				out, err := json.Marshal(newStateListRecord(result, attrFlags))
+				if err != nil {
+					c.Ui.Error(fmt.Sprintf("Failed to marshal result: %s", err))
+					return 1
 				}
+				c.Ui.Output(string(out))
 			}
+		}
 
-			c.Ui.Output(result.Address)
+	default:
+		for _, result := range results {
+			if _, ok := result.Value.(*states.ResourceInstance); ok {
+				c.Ui.Output(result.Address)
+			}
 		}
 	}
 
@@ -107,7 +226,10 @@ Usage: terraform state list [options] [pattern...]
   advanced filtering, please use tools such as "grep". The output of this
   command is designed to be friendly for this usage.
 
-  The pattern argument accepts any resource targeting syntax. Please
+  The pattern argument accepts any resource targeting syntax, plus glob
+  wildcards ("aws_instance.web_*"), instance key ranges
+  ("aws_instance.web[0-4]"), and attribute predicates against the
+  resource's attributes ("aws_instance.web[?tags.Env=="prod"]"). Please
   refer to the documentation on resource targeting syntax for more
   information.
 
@@ -119,6 +241,16 @@ Options:
 
   -id=ID              Restricts the output to objects whose id is ID.
 
+  -json               Print results as a JSON array of objects, one per
+                      resource, suitable for piping into tools like jq.
+
+  -jsonl              Print results as newline-delimited JSON, one object
+                      per resource.
+
+  -attr=PATH          Include the attribute at PATH (e.g. "tags.Env") in
+                      JSON output. May be repeated. The "id" attribute is
+                      always included. Has no effect without -json/-jsonl.
+
 `
 	return strings.TrimSpace(helpText)
 }
@@ -0,0 +1,121 @@
+package command
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/states"
+	"github.com/mitchellh/cli"
+)
+
+func testStateListState() *states.State {
+	return states.BuildState(func(s *states.SyncState) {
+		s.SetResourceInstanceCurrent(
+			addrs.Resource{
+				Mode: addrs.ManagedResourceMode,
+				Type: "test_instance",
+				Name: "foo",
+			}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance),
+			&states.ResourceInstanceObjectSrc{
+				Status:        states.ObjectReady,
+				AttrsJSON:     []byte(`{"id":"bar","ami":"ami-1234"}`),
+				SchemaVersion: 2,
+			},
+			addrs.AbsProviderConfig{
+				Provider: addrs.NewDefaultProvider("test"),
+				Module:   addrs.RootModule,
+			},
+		)
+	})
+}
+
+func TestStateList_json(t *testing.T) {
+	state := testStateListState()
+	statePath := testStateFile(t, state)
+
+	ui := new(cli.MockUi)
+	c := &StateListCommand{
+		Meta: Meta{Ui: ui},
+	}
+
+	if code := c.Run([]string{"-state", statePath, "-json"}); code != 0 {
+		t.Fatalf("bad: \n%s", ui.ErrorWriter.String())
+	}
+
+	var records []stateListRecord
+	if err := json.Unmarshal(ui.OutputWriter.Bytes(), &records); err != nil {
+		t.Fatalf("could not unmarshal output: %s", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	if records[0].Address != "test_instance.foo" {
+		t.Fatalf("bad address: %s", records[0].Address)
+	}
+	if records[0].Attributes["id"] != "bar" {
+		t.Fatalf("bad id attribute: %v", records[0].Attributes["id"])
+	}
+}
+
+func TestStateList_jsonlWithAttr(t *testing.T) {
+	state := testStateListState()
+	statePath := testStateFile(t, state)
+
+	ui := new(cli.MockUi)
+	c := &StateListCommand{
+		Meta: Meta{Ui: ui},
+	}
+
+	args := []string{"-state", statePath, "-jsonl", "-attr", "ami"}
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("bad: \n%s", ui.ErrorWriter.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(ui.OutputWriter.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 line, got %d: %v", len(lines), lines)
+	}
+
+	var record stateListRecord
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("could not unmarshal output line: %s", err)
+	}
+	if record.Attributes["ami"] != "ami-1234" {
+		t.Fatalf("bad ami attribute: %v", record.Attributes["ami"])
+	}
+}
+
+func TestStateList_jsonAndJsonlMutuallyExclusive(t *testing.T) {
+	ui := new(cli.MockUi)
+	c := &StateListCommand{
+		Meta: Meta{Ui: ui},
+	}
+
+	if code := c.Run([]string{"-json", "-jsonl"}); code != cli.RunResultHelp {
+		t.Fatalf("expected RunResultHelp, got %d", code)
+	}
+}
+
+func TestStateList_idFlagWithPattern(t *testing.T) {
+	state := testStateListState()
+	statePath := testStateFile(t, state)
+
+	ui := new(cli.MockUi)
+	c := &StateListCommand{
+		Meta: Meta{Ui: ui},
+	}
+
+	// The "-id" flag must compose with a glob pattern argument, keeping only
+	// the pattern's matches that also have the given id.
+	args := []string{"-state", statePath, "-id", "bar", "test_instance.*"}
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("bad: \n%s", ui.ErrorWriter.String())
+	}
+
+	actual := strings.TrimSpace(ui.OutputWriter.String())
+	if actual != "test_instance.foo" {
+		t.Fatalf("bad: %q", actual)
+	}
+}
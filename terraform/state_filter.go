@@ -3,6 +3,8 @@ package terraform
 import (
 	"fmt"
 	"sort"
+	"strings"
+	"sync"
 
 	"github.com/hashicorp/terraform/addrs"
 	"github.com/hashicorp/terraform/states"
@@ -20,40 +22,66 @@ import (
 // changing the State without calling Reset, the behavior is not defined.
 type StateFilter struct {
 	State *states.State
+
+	indexMu sync.RWMutex
+	index   *stateFilterIndex
+}
+
+// ensureIndex builds this StateFilter's sidecar index on first use and
+// returns it. The index is immutable once built, so once indexMu confirms
+// it exists, callers can read it without further synchronization.
+func (f *StateFilter) ensureIndex() *stateFilterIndex {
+	f.indexMu.RLock()
+	idx := f.index
+	f.indexMu.RUnlock()
+	if idx != nil {
+		return idx
+	}
+
+	f.indexMu.Lock()
+	defer f.indexMu.Unlock()
+	if f.index == nil {
+		f.index = buildStateFilterIndex(f.State)
+	}
+	return f.index
+}
+
+// Reset discards the sidecar index built by Filter, forcing it to be
+// rebuilt on the next call. Call this after mutating the State that this
+// StateFilter was created with; otherwise Filter may consult a stale
+// index and return incorrect results.
+func (f *StateFilter) Reset() {
+	f.indexMu.Lock()
+	defer f.indexMu.Unlock()
+	f.index = nil
 }
 
 // Filter takes the addresses specified by fs and finds all the matches.
 // The values of fs are resource addressing syntax that can be parsed by
-// ParseResourceAddress.
+// ParseResourceAddress, or the extended glob/predicate pattern syntax
+// described on parsePattern.
 func (f *StateFilter) Filter(fs ...string) ([]*StateFilterResult, error) {
-	// Parse all the addresses
-	as := make([]addrs.Targetable, len(fs))
+	// Compile all of the patterns up front so that a malformed argument
+	// is reported before we've done any work against the state.
+	matchers := make([]*filterMatcher, len(fs))
 	for i, v := range fs {
-		if addr, diags := addrs.ParseModuleInstanceStr(v); !diags.HasErrors() {
-			as[i] = addr
-			continue
-		}
-		if addr, diags := addrs.ParseAbsResourceStr(v); !diags.HasErrors() {
-			as[i] = addr
-			continue
-		}
-		if addr, diags := addrs.ParseAbsResourceInstanceStr(v); !diags.HasErrors() {
-			as[i] = addr
-			continue
+		m, err := compileFilterArg(v)
+		if err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("Error parsing address '%s'", v)
+		matchers[i] = m
 	}
 
 	// If we weren't given any filters, then we list all
 	if len(fs) == 0 {
-		as = append(as, addrs.RootModuleInstance)
+		matchers = append(matchers, &filterMatcher{exact: addrs.RootModuleInstance})
 	}
 
 	// Filter each of the address. We keep track of this in a map to
 	// strip duplicates.
 	resultSet := make(map[string]*StateFilterResult)
-	for _, addr := range as {
-		for _, r := range f.filterSingle(addr) {
+	for _, m := range matchers {
+		for _, r := range f.filterSingle(m) {
 			resultSet[r.String()] = r
 		}
 	}
@@ -69,44 +97,132 @@ func (f *StateFilter) Filter(fs ...string) ([]*StateFilterResult, error) {
 	return results, nil
 }
 
-func (f *StateFilter) filterSingle(addr addrs.Targetable) []*StateFilterResult {
-	// The slice to keep track of results
-	var results []*StateFilterResult
+// ResultsWithID returns every result whose "id" attribute equals id, using
+// the sidecar id-index built by ensureIndex so that StateListCommand's
+// "-id" flag doesn't need to decode every instance's attributes itself.
+// The results are sorted the same way Filter's are.
+func (f *StateFilter) ResultsWithID(id string) []*StateFilterResult {
+	results := f.ensureIndex().byID[id]
+	sorted := make([]*StateFilterResult, len(results))
+	copy(sorted, results)
+	sort.Sort(StateFilterResultSlice(sorted))
+	return sorted
+}
+
+func (f *StateFilter) filterSingle(m *filterMatcher) []*StateFilterResult {
+	if m.isExact() {
+		return f.filterExact(m.exact)
+	}
+	return f.filterPattern(m)
+}
+
+// filterExact implements the historical, addrs.Targetable based matching
+// behavior for addresses that don't use any glob or predicate syntax. It
+// dispatches on the concrete type of addr so that a specific resource or
+// resource instance address only visits the modules and resources that
+// could possibly match, using the sidecar index built by ensureIndex,
+// rather than walking the whole state.
+func (f *StateFilter) filterExact(addr addrs.Targetable) []*StateFilterResult {
+	idx := f.ensureIndex()
+
+	switch filter := addr.(type) {
+	case addrs.AbsResource:
+		refs := f.resourceRefs(idx, filter.Module, filter.Resource)
+		return f.filterExactRefs(addr, refs)
+	case addrs.AbsResourceInstance:
+		refs := f.resourceRefs(idx, filter.Module, filter.Resource.Resource)
+		return f.filterExactRefs(addr, refs)
+	default:
+		moduleFilter, ok := addr.(addrs.ModuleInstance)
+		if !ok {
+			moduleFilter = addrs.RootModuleInstance
+		}
+		return f.filterExactModules(addr, moduleFilter, idx)
+	}
+}
+
+// resourceRefs narrows down the (module, resource) pairs that a resource
+// address filter could match: a single map lookup for a module-qualified
+// address, or the precomputed type+name index for an address that matches
+// a resource type and name in any module.
+func (f *StateFilter) resourceRefs(idx *stateFilterIndex, module addrs.ModuleInstance, res addrs.Resource) []stateFilterResourceRef {
+	if module == nil {
+		return idx.byTypeName[typeNameKey(res.Mode, res.Type, res.Name)]
+	}
 
-	// Check if we received a module instance address that
-	// should be used as module filter, and if not set the
-	// filter to the root module instance.
-	filter, ok := addr.(addrs.ModuleInstance)
+	m, ok := idx.byModule[module.String()]
 	if !ok {
-		filter = addrs.RootModuleInstance
+		return nil
 	}
 
-	// Go through modules first.
-	modules := make([]*states.Module, 0, len(f.State.Modules))
-	for _, m := range f.State.Modules {
-		if filter.IsRoot() || filter.Equal(m.Addr) {
-			modules = append(modules, m)
+	var refs []stateFilterResourceRef
+	for _, r := range m.Resources {
+		if r.Addr.Equal(res) {
+			refs = append(refs, stateFilterResourceRef{module: m, resource: r})
+		}
+	}
+	return refs
+}
+
+// filterExactRefs applies the original relevant() equality check to each
+// instance of each candidate resource. The refs are already narrowed by
+// resourceRefs, so this only visits instances that could possibly match.
+func (f *StateFilter) filterExactRefs(addr addrs.Targetable, refs []stateFilterResourceRef) []*StateFilterResult {
+	var results []*StateFilterResult
 
-			// Only add the module to the results if we searched
-			// for a specific non-root module and found a match.
-			if !filter.IsRoot() && filter.Equal(m.Addr) {
+	for _, ref := range refs {
+		absAddr := ref.resource.Addr.Absolute(ref.module.Addr)
+		for key, is := range ref.resource.Instances {
+			if f.relevant(addr, absAddr, key) {
 				results = append(results, &StateFilterResult{
-					Address: m.Addr.String(),
-					Value:   m,
+					Address:  absAddr.Instance(key).String(),
+					Value:    is,
+					module:   ref.module.Addr,
+					resource: ref.resource,
+					key:      key,
 				})
 			}
 		}
 	}
 
-	// With the modules set, go through all the resources within
-	// the modules to find relevant resources.
+	return results
+}
+
+// filterExactModules implements the module-instance and "list everything"
+// cases: a plain module address, or no address at all (the root module,
+// used as a sentinel meaning "every resource").
+func (f *StateFilter) filterExactModules(addr addrs.Targetable, moduleFilter addrs.ModuleInstance, idx *stateFilterIndex) []*StateFilterResult {
+	var results []*StateFilterResult
+	var modules []*states.Module
+
+	if moduleFilter.IsRoot() {
+		modules = make([]*states.Module, 0, len(idx.byModule))
+		for _, m := range idx.byModule {
+			modules = append(modules, m)
+		}
+	} else {
+		m, ok := idx.byModule[moduleFilter.String()]
+		if !ok {
+			return nil
+		}
+		modules = []*states.Module{m}
+		results = append(results, &StateFilterResult{
+			Address: m.Addr.String(),
+			Value:   m,
+			module:  m.Addr,
+		})
+	}
+
 	for _, m := range modules {
 		for _, r := range m.Resources {
 			for key, is := range r.Instances {
 				if f.relevant(addr, r.Addr.Absolute(m.Addr), key) {
 					results = append(results, &StateFilterResult{
-						Address: r.Addr.Absolute(m.Addr).Instance(key).String(),
-						Value:   is,
+						Address:  r.Addr.Absolute(m.Addr).Instance(key).String(),
+						Value:    is,
+						module:   m.Addr,
+						resource: r,
+						key:      key,
 					})
 				}
 			}
@@ -116,6 +232,149 @@ func (f *StateFilter) filterSingle(addr addrs.Targetable) []*StateFilterResult {
 	return results
 }
 
+// filterPattern implements matching for the glob, key-range, and attribute
+// predicate syntax compiled into a filterMatcher by parsePattern. It uses
+// the sidecar index's id-index or type-index for the two common cases
+// where a pattern narrows down to a small, indexable candidate set, and
+// otherwise falls back to a full scan of the state.
+func (f *StateFilter) filterPattern(fm *filterMatcher) []*StateFilterResult {
+	if results, ok := f.filterPatternByID(fm); ok {
+		return results
+	}
+	if refs, ok := f.filterPatternByType(fm); ok {
+		return f.matchResourceRefs(fm, refs)
+	}
+	return f.filterPatternScan(fm)
+}
+
+// filterPatternByID recognizes a bare id lookup pattern --
+// "*.*[?id==\"...\"]", with no module prefix and no mode/type/name/key
+// constraint -- and answers it directly from the id-index instead of
+// decoding every instance's attributes. Like any pattern without a module
+// prefix, it only matches resources in the root module.
+func (f *StateFilter) filterPatternByID(fm *filterMatcher) ([]*StateFilterResult, bool) {
+	if len(fm.moduleSegs) != 0 || fm.hasMode || fm.typeGlob != "*" || fm.nameGlob != "*" || fm.key != nil {
+		return nil, false
+	}
+	cmp, ok := fm.predicate.(compareExpr)
+	if !ok || cmp.path != "id" || cmp.op != "==" {
+		return nil, false
+	}
+	var results []*StateFilterResult
+	for _, r := range f.ensureIndex().byID[cmp.value] {
+		if moduleMatches(fm.moduleSegs, r.module) {
+			results = append(results, r)
+		}
+	}
+	return results, true
+}
+
+// filterPatternByType recognizes a pattern with a literal (non-glob)
+// resource type and answers it from the type-index, which is far smaller
+// than the full state once there are many resource types.
+func (f *StateFilter) filterPatternByType(fm *filterMatcher) ([]stateFilterResourceRef, bool) {
+	if strings.Contains(fm.typeGlob, "*") {
+		return nil, false
+	}
+	return f.ensureIndex().byType[fm.typeGlob], true
+}
+
+func (f *StateFilter) matchResourceRefs(fm *filterMatcher, refs []stateFilterResourceRef) []*StateFilterResult {
+	var results []*StateFilterResult
+	for _, ref := range refs {
+		if !moduleMatches(fm.moduleSegs, ref.module.Addr) {
+			continue
+		}
+		results = append(results, f.matchResourceInstances(fm, ref.module, ref.resource)...)
+	}
+	return results
+}
+
+func (f *StateFilter) filterPatternScan(fm *filterMatcher) []*StateFilterResult {
+	var results []*StateFilterResult
+
+	for _, m := range f.State.Modules {
+		if !moduleMatches(fm.moduleSegs, m.Addr) {
+			continue
+		}
+		for _, r := range m.Resources {
+			results = append(results, f.matchResourceInstances(fm, m, r)...)
+		}
+	}
+
+	return results
+}
+
+// matchResourceInstances applies a filterMatcher's mode, name, key, and
+// predicate constraints to a single resource's instances.
+func (f *StateFilter) matchResourceInstances(fm *filterMatcher, m *states.Module, r *states.Resource) []*StateFilterResult {
+	if fm.hasMode && r.Addr.Mode != fm.mode {
+		return nil
+	}
+	if !globMatch(fm.typeGlob, r.Addr.Type) || !globMatch(fm.nameGlob, r.Addr.Name) {
+		return nil
+	}
+
+	var results []*StateFilterResult
+	for key, is := range r.Instances {
+		if fm.key != nil && !fm.key.MatchKey(key) {
+			continue
+		}
+		if fm.predicate != nil {
+			matched, err := evalPredicate(fm.predicate, is)
+			if err != nil || !matched {
+				continue
+			}
+		}
+
+		results = append(results, &StateFilterResult{
+			Address:  r.Addr.Absolute(m.Addr).Instance(key).String(),
+			Value:    is,
+			module:   m.Addr,
+			resource: r,
+			key:      key,
+		})
+	}
+	return results
+}
+
+// moduleMatches reports whether a module instance address matches a
+// sequence of per-step segments parsed from repeated "module.<glob>"
+// prefixes, each with an optional "[key]" instance key restriction. A
+// nil/empty segment list matches only the root module.
+func moduleMatches(segs []moduleSeg, addr addrs.ModuleInstance) bool {
+	if len(segs) == 0 {
+		return addr.IsRoot()
+	}
+	if len(addr) != len(segs) {
+		return false
+	}
+	for i, step := range addr {
+		seg := segs[i]
+		if !globMatch(seg.glob, step.Name) {
+			return false
+		}
+		if seg.key != nil && !seg.key.MatchKey(step.InstanceKey) {
+			return false
+		}
+	}
+	return true
+}
+
+// evalPredicate decodes the current attributes of a resource instance and
+// evaluates a compiled `[?...]` predicate against them. An instance with no
+// current object never matches a predicate.
+func evalPredicate(expr predicateExpr, is *states.ResourceInstance) (bool, error) {
+	if !is.HasCurrent() {
+		return false, nil
+	}
+	attrs, err := decodeAttrs(is.Current.AttrsJSON)
+	if err != nil {
+		return false, err
+	}
+	return expr.Eval(attrs)
+}
+
 func (f *StateFilter) relevant(filter addrs.Targetable, addr addrs.AbsResource, key addrs.InstanceKey) bool {
 	switch filter := filter.(type) {
 	case addrs.AbsResource:
@@ -142,12 +401,100 @@ type StateFilterResult struct {
 	// Value is the actual value. This must be type switched on. It can be
 	// any either a `states.Module` or `states.ResourceInstance`.
 	Value interface{}
+
+	// module, resource, and key record where this result was found in the
+	// state. resource and key are only set when Value is a
+	// *states.ResourceInstance; they let callers reach resource-level
+	// metadata (mode, type, provider, schema version) through the
+	// accessors below without re-walking the state themselves.
+	module   addrs.ModuleInstance
+	resource *states.Resource
+	key      addrs.InstanceKey
 }
 
 func (r *StateFilterResult) String() string {
 	return fmt.Sprintf("%T: %s", r.Value, r.Address)
 }
 
+// ModuleAddr returns the address of the module instance this result was
+// found in.
+func (r *StateFilterResult) ModuleAddr() addrs.ModuleInstance {
+	return r.module
+}
+
+// Resource returns the states.Resource that this result's instance belongs
+// to, and true. It returns (nil, false) when Value is not a
+// *states.ResourceInstance.
+func (r *StateFilterResult) Resource() (*states.Resource, bool) {
+	return r.resource, r.resource != nil
+}
+
+// InstanceKey returns the instance key of this result's resource instance,
+// and true. It returns (nil, false) when Value is not a
+// *states.ResourceInstance.
+func (r *StateFilterResult) InstanceKey() (addrs.InstanceKey, bool) {
+	if r.resource == nil {
+		return nil, false
+	}
+	return r.key, true
+}
+
+// ProviderConfig returns the provider configuration address responsible for
+// this result's resource, and true. It returns (zero value, false) when
+// Value is not a *states.ResourceInstance.
+func (r *StateFilterResult) ProviderConfig() (addrs.AbsProviderConfig, bool) {
+	if r.resource == nil {
+		return addrs.AbsProviderConfig{}, false
+	}
+	return r.resource.ProviderConfig, true
+}
+
+// SchemaVersion returns the schema version recorded against this result's
+// current object, and true. It returns (0, false) when Value is not a
+// *states.ResourceInstance or has no current object.
+func (r *StateFilterResult) SchemaVersion() (uint64, bool) {
+	is, ok := r.Value.(*states.ResourceInstance)
+	if !ok || !is.HasCurrent() {
+		return 0, false
+	}
+	return is.Current.SchemaVersion, true
+}
+
+// Attrs decodes this result's current attributes as JSON, returning an
+// empty map when there is no current object or Value is not a
+// *states.ResourceInstance.
+func (r *StateFilterResult) Attrs() (map[string]interface{}, error) {
+	is, ok := r.Value.(*states.ResourceInstance)
+	if !ok || !is.HasCurrent() {
+		return map[string]interface{}{}, nil
+	}
+	return decodeAttrs(is.Current.AttrsJSON)
+}
+
+// Attr resolves a single dotted/indexed JSON path (e.g. "id" or
+// "tags.Env") against this result's current attributes, using the same
+// path syntax as an attribute predicate. It returns (nil, false) if the
+// path doesn't resolve.
+//
+// Callers resolving more than one path against the same result should
+// call Attrs once and use LookupAttr instead, to avoid decoding the
+// underlying AttrsJSON once per path.
+func (r *StateFilterResult) Attr(path string) (interface{}, bool) {
+	attrs, err := r.Attrs()
+	if err != nil {
+		return nil, false
+	}
+	return LookupAttr(attrs, path)
+}
+
+// LookupAttr resolves a single dotted/indexed JSON path (e.g. "id" or
+// "tags.Env") against an already-decoded attribute map, such as one
+// returned by StateFilterResult.Attrs. It returns (nil, false) if the
+// path doesn't resolve.
+func LookupAttr(attrs map[string]interface{}, path string) (interface{}, bool) {
+	return lookupPath(attrs, path)
+}
+
 func (r *StateFilterResult) sortedType() int {
 	switch r.Value.(type) {
 	case *states.Module:
@@ -0,0 +1,88 @@
+package terraform
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/states"
+)
+
+// benchFilterState builds a synthetic state with n "aws_instance" resources
+// spread across a handful of resource names, each with a distinct "id"
+// attribute, to exercise the sidecar indexes' asymptotic behavior rather
+// than the small fixture used by the correctness tests in
+// state_filter_test.go.
+func benchFilterState(n int) *states.State {
+	return states.BuildState(func(s *states.SyncState) {
+		for i := 0; i < n; i++ {
+			name := fmt.Sprintf("web%d", i%10)
+			s.SetResourceInstanceCurrent(
+				addrs.Resource{
+					Mode: addrs.ManagedResourceMode,
+					Type: "aws_instance",
+					Name: name,
+				}.Instance(addrs.IntKey(i/10)).Absolute(addrs.RootModuleInstance),
+				&states.ResourceInstanceObjectSrc{
+					Status:    states.ObjectReady,
+					AttrsJSON: []byte(fmt.Sprintf(`{"id":"i-%08d"}`, i)),
+				},
+				addrs.AbsProviderConfig{
+					Provider: addrs.NewDefaultProvider("aws"),
+					Module:   addrs.RootModule,
+				},
+			)
+		}
+	})
+}
+
+// BenchmarkStateFilter_byID demonstrates the win from the id-index: after
+// the first Filter call builds the sidecar index, an "-id" style lookup no
+// longer decodes every instance's attributes.
+func BenchmarkStateFilter_byID(b *testing.B) {
+	state := benchFilterState(10000)
+	f := &StateFilter{State: state}
+
+	// Build the index once, outside the timed loop, the same way the first
+	// real Filter call in a "terraform state list" invocation would.
+	if _, err := f.Filter("aws_instance.web0"); err != nil {
+		b.Fatalf("warmup Filter failed: %s", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if len(f.ResultsWithID("i-00005000")) != 1 {
+			b.Fatalf("expected exactly one match")
+		}
+	}
+}
+
+// BenchmarkStateFilter_byType demonstrates the win from the type+name index
+// for an exact resource address, which only visits the instances of that
+// one resource instead of every resource in the state.
+func BenchmarkStateFilter_byType(b *testing.B) {
+	state := benchFilterState(10000)
+	f := &StateFilter{State: state}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := f.Filter("aws_instance.web5"); err != nil {
+			b.Fatalf("Filter failed: %s", err)
+		}
+	}
+}
+
+// BenchmarkStateFilter_scan is the worst case -- a type glob that can't use
+// the type-index -- included for comparison against the two benchmarks
+// above.
+func BenchmarkStateFilter_scan(b *testing.B) {
+	state := benchFilterState(10000)
+	f := &StateFilter{State: state}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := f.Filter("aws_*.web5"); err != nil {
+			b.Fatalf("Filter failed: %s", err)
+		}
+	}
+}
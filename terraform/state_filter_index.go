@@ -0,0 +1,90 @@
+package terraform
+
+import (
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/states"
+)
+
+// stateFilterIndex holds the sidecar lookup structures that let Filter
+// resolve a specific address in roughly constant time instead of walking
+// every module and resource in the state. It is built once per StateFilter
+// (see StateFilter.ensureIndex) and is never mutated afterward, so it's
+// safe to share across concurrent Filter calls.
+type stateFilterIndex struct {
+	// byModule maps a module instance address string to the module it
+	// identifies.
+	byModule map[string]*states.Module
+
+	// byType maps a resource type (e.g. "aws_instance") to every
+	// (module, resource) pair of that type, across all modules and both
+	// resource modes.
+	byType map[string][]stateFilterResourceRef
+
+	// byTypeName maps "<mode>.<type>.<name>" to every (module, resource)
+	// pair with that type and name, across all modules. This is what
+	// answers an addrs.AbsResource filter with no module component, e.g.
+	// "aws_instance.web".
+	byTypeName map[string][]stateFilterResourceRef
+
+	// byID maps the "id" attribute of a resource instance's current
+	// object to every instance with that ID, letting StateListCommand's
+	// "-id" flag (through ResultsWithID) and a bare `*.*[?id=="..."]`
+	// pattern skip decoding every instance's attributes.
+	byID map[string][]*StateFilterResult
+}
+
+// stateFilterResourceRef pairs a resource with the module it was found in,
+// since states.Resource itself doesn't know its containing module.
+type stateFilterResourceRef struct {
+	module   *states.Module
+	resource *states.Resource
+}
+
+func buildStateFilterIndex(state *states.State) *stateFilterIndex {
+	idx := &stateFilterIndex{
+		byModule:   make(map[string]*states.Module),
+		byType:     make(map[string][]stateFilterResourceRef),
+		byTypeName: make(map[string][]stateFilterResourceRef),
+		byID:       make(map[string][]*StateFilterResult),
+	}
+	if state == nil {
+		return idx
+	}
+
+	for _, m := range state.Modules {
+		idx.byModule[m.Addr.String()] = m
+
+		for _, r := range m.Resources {
+			ref := stateFilterResourceRef{module: m, resource: r}
+			idx.byType[r.Addr.Type] = append(idx.byType[r.Addr.Type], ref)
+			idx.byTypeName[typeNameKey(r.Addr.Mode, r.Addr.Type, r.Addr.Name)] = append(idx.byTypeName[typeNameKey(r.Addr.Mode, r.Addr.Type, r.Addr.Name)], ref)
+
+			for key, is := range r.Instances {
+				if !is.HasCurrent() {
+					continue
+				}
+				attrs, err := decodeAttrs(is.Current.AttrsJSON)
+				if err != nil {
+					continue
+				}
+				id, ok := attrs["id"].(string)
+				if !ok || id == "" {
+					continue
+				}
+				idx.byID[id] = append(idx.byID[id], &StateFilterResult{
+					Address:  r.Addr.Absolute(m.Addr).Instance(key).String(),
+					Value:    is,
+					module:   m.Addr,
+					resource: r,
+					key:      key,
+				})
+			}
+		}
+	}
+
+	return idx
+}
+
+func typeNameKey(mode addrs.ResourceMode, resourceType, name string) string {
+	return mode.String() + "." + resourceType + "." + name
+}
@@ -0,0 +1,605 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+// filterMatcher is the compiled form of a single Filter argument. It is
+// produced by compileFilterArg and consulted by filterSingle so that plain
+// resource addresses, glob wildcards, instance key ranges, and attribute
+// predicates all flow through the same matching path rather than each
+// having their own code path in filterSingle.
+//
+// Exactly one of exact or the glob/predicate fields is populated: an
+// argument that parses as a plain addrs.Targetable keeps the historical,
+// exact-match behavior, while anything containing glob or predicate syntax
+// is matched structurally against the state.
+type filterMatcher struct {
+	exact addrs.Targetable
+
+	// moduleSegs is nil for the root module (or when no module prefix was
+	// given), and otherwise holds one segment per "module.<name>" step of
+	// the requested module path.
+	moduleSegs []moduleSeg
+
+	mode    addrs.ResourceMode
+	hasMode bool
+
+	typeGlob string
+	nameGlob string
+
+	// key restricts which instance keys are considered, and is nil if
+	// every instance of a matching resource should be considered.
+	key keyMatcher
+
+	// predicate, if non-nil, must evaluate true against the JSON-decoded
+	// current attributes of a resource instance for it to match.
+	predicate predicateExpr
+}
+
+// isExact reports whether this matcher is a plain addrs.Targetable that can
+// be matched with the historical relevant() logic.
+func (m *filterMatcher) isExact() bool {
+	return m.exact != nil
+}
+
+// compileFilterArg parses a single Filter argument into a filterMatcher.
+// It first tries the existing exact-address parsers so that the common
+// case (an address copy-pasted from `terraform state list` output) keeps
+// its current, unambiguous behavior. An argument containing "*" skips the
+// exact parsers, so that a quoted key glob like `["prod-*"]` is not taken
+// as a literal string key. Anything else is parsed as a pattern that may
+// contain glob wildcards, an instance key range, or an attribute predicate.
+func compileFilterArg(raw string) (*filterMatcher, error) {
+	if !strings.Contains(raw, "*") {
+		if addr, diags := addrs.ParseModuleInstanceStr(raw); !diags.HasErrors() {
+			return &filterMatcher{exact: addr}, nil
+		}
+		if addr, diags := addrs.ParseAbsResourceStr(raw); !diags.HasErrors() {
+			return &filterMatcher{exact: addr}, nil
+		}
+		if addr, diags := addrs.ParseAbsResourceInstanceStr(raw); !diags.HasErrors() {
+			return &filterMatcher{exact: addr}, nil
+		}
+	}
+
+	m, err := parsePattern(raw)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing address '%s': %s", raw, err)
+	}
+	return m, nil
+}
+
+// parsePattern parses the glob/predicate address syntax described in the
+// "state list" documentation, e.g.:
+//
+//	module.*.aws_instance.web_*
+//	aws_instance.web[0-4]
+//	aws_instance.web["prod-*"]
+//	aws_instance.web[?tags.Env=="prod"]
+//	aws_*.*[*]
+func parsePattern(raw string) (*filterMatcher, error) {
+	rest := raw
+	m := &filterMatcher{}
+
+	for strings.HasPrefix(rest, "module.") {
+		rest = strings.TrimPrefix(rest, "module.")
+		name, tail, err := splitSegment(rest)
+		if err != nil {
+			return nil, err
+		}
+		glob, bracket, err := splitBracket(name)
+		if err != nil {
+			return nil, err
+		}
+		seg := moduleSeg{glob: glob}
+		if bracket != "" {
+			key, err := parseKeyMatcher(bracket)
+			if err != nil {
+				return nil, fmt.Errorf("invalid module instance key %q: %s", bracket, err)
+			}
+			seg.key = key
+		}
+		m.moduleSegs = append(m.moduleSegs, seg)
+		rest = tail
+	}
+
+	if strings.HasPrefix(rest, "data.") {
+		m.hasMode = true
+		m.mode = addrs.DataResourceMode
+		rest = strings.TrimPrefix(rest, "data.")
+	}
+
+	typeSeg, rest, err := splitSegment(rest)
+	if err != nil {
+		return nil, err
+	}
+	if rest == "" {
+		return nil, fmt.Errorf("expected TYPE.NAME, got %q", raw)
+	}
+	m.typeGlob = typeSeg
+
+	nameSeg, rest, err := splitSegment(rest)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("unexpected trailing input %q", rest)
+	}
+
+	nameGlob, bracket, err := splitBracket(nameSeg)
+	if err != nil {
+		return nil, err
+	}
+	m.nameGlob = nameGlob
+
+	if bracket != "" {
+		if strings.HasPrefix(bracket, "?") {
+			expr, err := parsePredicate(bracket[1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid predicate %q: %s", bracket, err)
+			}
+			m.predicate = expr
+		} else {
+			key, err := parseKeyMatcher(bracket)
+			if err != nil {
+				return nil, fmt.Errorf("invalid instance key %q: %s", bracket, err)
+			}
+			m.key = key
+		}
+	}
+
+	return m, nil
+}
+
+// splitSegment splits the next dot-separated segment off of s, respecting
+// bracket nesting and quoted strings so that a "." inside `[?a=="b.c"]`
+// isn't mistaken for a segment boundary.
+func splitSegment(s string) (segment, rest string, err error) {
+	depth := 0
+	inQuote := false
+	for i, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case inQuote:
+			// no-op, inside a quoted string
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+			if depth < 0 {
+				return "", "", fmt.Errorf("unbalanced ']' in %q", s)
+			}
+		case r == '.' && depth == 0:
+			return s[:i], s[i+1:], nil
+		}
+	}
+	if inQuote {
+		return "", "", fmt.Errorf("unterminated quote in %q", s)
+	}
+	if depth != 0 {
+		return "", "", fmt.Errorf("unbalanced '[' in %q", s)
+	}
+	return s, "", nil
+}
+
+// splitBracket splits "name[body]" into ("name", "body"). If s has no
+// bracket, body is returned empty.
+func splitBracket(s string) (name, body string, err error) {
+	idx := strings.IndexByte(s, '[')
+	if idx == -1 {
+		return s, "", nil
+	}
+	if !strings.HasSuffix(s, "]") {
+		return "", "", fmt.Errorf("unterminated '[' in %q", s)
+	}
+	return s[:idx], s[idx+1 : len(s)-1], nil
+}
+
+// globMatch reports whether s matches pattern, where "*" in pattern matches
+// any run of characters (including none). It is deliberately simpler than
+// path.Match: address segments may legitimately contain characters (like
+// "-") that some glob implementations treat specially.
+func globMatch(pattern, s string) bool {
+	if pattern == "*" || pattern == "" {
+		return pattern == "*" || s == ""
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(pattern, "*") {
+		if !strings.HasPrefix(s, parts[0]) {
+			return false
+		}
+		s = s[len(parts[0]):]
+		parts = parts[1:]
+	}
+	if len(parts) > 0 && !strings.HasSuffix(pattern, "*") {
+		last := parts[len(parts)-1]
+		if !strings.HasSuffix(s, last) {
+			return false
+		}
+		s = s[:len(s)-len(last)]
+		parts = parts[:len(parts)-1]
+	}
+	for _, part := range parts {
+		if part == "" {
+			continue
+		}
+		idx := strings.Index(s, part)
+		if idx == -1 {
+			return false
+		}
+		s = s[idx+len(part):]
+	}
+	return true
+}
+
+// moduleSeg is one "module.<glob>" step of a pattern's module path, with an
+// optional instance key restriction parsed from a bracketed suffix like
+// "module.foo[0]" or `module.foo["prod"]`. A nil key matches any instance
+// key, including the no-key (un-expanded) case.
+type moduleSeg struct {
+	glob string
+	key  keyMatcher
+}
+
+// keyMatcher decides whether a given instance key satisfies an instance
+// key portion of a pattern (e.g. "0-4", "*", or `"prod-*"`).
+type keyMatcher interface {
+	MatchKey(addrs.InstanceKey) bool
+}
+
+type anyKeyMatcher struct{}
+
+func (anyKeyMatcher) MatchKey(addrs.InstanceKey) bool { return true }
+
+type intRangeMatcher struct {
+	lo, hi int
+}
+
+func (m intRangeMatcher) MatchKey(k addrs.InstanceKey) bool {
+	ik, ok := k.(addrs.IntKey)
+	if !ok {
+		return false
+	}
+	return int(ik) >= m.lo && int(ik) <= m.hi
+}
+
+type stringGlobMatcher struct {
+	glob string
+}
+
+func (m stringGlobMatcher) MatchKey(k addrs.InstanceKey) bool {
+	sk, ok := k.(addrs.StringKey)
+	if !ok {
+		return false
+	}
+	return globMatch(m.glob, string(sk))
+}
+
+// parseKeyMatcher parses the contents of a "[...]" instance key selector
+// that is not an attribute predicate: "*", "0-4", "3", or `"prod-*"`.
+func parseKeyMatcher(body string) (keyMatcher, error) {
+	if body == "*" {
+		return anyKeyMatcher{}, nil
+	}
+	if strings.HasPrefix(body, `"`) && strings.HasSuffix(body, `"`) && len(body) >= 2 {
+		return stringGlobMatcher{glob: body[1 : len(body)-1]}, nil
+	}
+	if lo, hi, ok := splitIntRange(body); ok {
+		return intRangeMatcher{lo: lo, hi: hi}, nil
+	}
+	if n, err := strconv.Atoi(body); err == nil {
+		return intRangeMatcher{lo: n, hi: n}, nil
+	}
+	return nil, fmt.Errorf("expected \"*\", an integer, an integer range like \"0-4\", or a quoted string, got %q", body)
+}
+
+func splitIntRange(body string) (lo, hi int, ok bool) {
+	parts := strings.SplitN(body, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	lo, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	hi, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return lo, hi, true
+}
+
+// predicateExpr is a compiled `[?...]` attribute predicate, evaluated
+// against the JSON-decoded current attributes of a resource instance.
+type predicateExpr interface {
+	Eval(attrs map[string]interface{}) (bool, error)
+}
+
+type andExpr struct{ left, right predicateExpr }
+
+func (e andExpr) Eval(attrs map[string]interface{}) (bool, error) {
+	l, err := e.left.Eval(attrs)
+	if err != nil || !l {
+		return false, err
+	}
+	return e.right.Eval(attrs)
+}
+
+type orExpr struct{ left, right predicateExpr }
+
+func (e orExpr) Eval(attrs map[string]interface{}) (bool, error) {
+	l, err := e.left.Eval(attrs)
+	if err != nil {
+		return false, err
+	}
+	if l {
+		return true, nil
+	}
+	return e.right.Eval(attrs)
+}
+
+type compareExpr struct {
+	path  string
+	op    string
+	value string
+	re    *regexp.Regexp // only set when op == "=~"
+}
+
+func (e compareExpr) Eval(attrs map[string]interface{}) (bool, error) {
+	got, ok := lookupPath(attrs, e.path)
+	gotStr := fmt.Sprintf("%v", got)
+
+	switch e.op {
+	case "==":
+		return ok && gotStr == e.value, nil
+	case "!=":
+		return ok && gotStr != e.value, nil
+	case "=~":
+		return ok && e.re.MatchString(gotStr), nil
+	case "<", ">":
+		gotNum, gotIsNum := toFloat(got)
+		wantNum, wantErr := strconv.ParseFloat(e.value, 64)
+		if !ok || !gotIsNum || wantErr != nil {
+			return false, nil
+		}
+		if e.op == "<" {
+			return gotNum < wantNum, nil
+		}
+		return gotNum > wantNum, nil
+	default:
+		return false, fmt.Errorf("unsupported operator %q", e.op)
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
+
+// lookupPath resolves a dotted/indexed JSON path such as "tags.Env" or
+// "items[0].id" against a decoded attribute map.
+func lookupPath(attrs map[string]interface{}, path string) (interface{}, bool) {
+	var cur interface{} = attrs
+	for _, seg := range splitPath(path) {
+		if idx, isIdx := seg.index(); isIdx {
+			arr, ok := cur.([]interface{})
+			if !ok || idx < 0 || idx >= len(arr) {
+				return nil, false
+			}
+			cur = arr[idx]
+			continue
+		}
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		cur, ok = m[seg.name]
+		if !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+type pathSeg struct {
+	name string
+	idx  int
+	isIx bool
+}
+
+func (s pathSeg) index() (int, bool) { return s.idx, s.isIx }
+
+// splitPath tokenizes a dotted, indexed JSON path such as "tags.Env" or
+// "items[0].id" into a left-to-right sequence of map-key and array-index
+// steps.
+func splitPath(path string) []pathSeg {
+	var segs []pathSeg
+	for _, part := range strings.Split(path, ".") {
+		name := part
+		var idxs []int
+		for strings.HasSuffix(name, "]") {
+			open := strings.LastIndexByte(name, '[')
+			if open == -1 {
+				break
+			}
+			n, err := strconv.Atoi(name[open+1 : len(name)-1])
+			if err != nil {
+				break
+			}
+			idxs = append([]int{n}, idxs...)
+			name = name[:open]
+		}
+		if name != "" {
+			segs = append(segs, pathSeg{name: name})
+		}
+		for _, n := range idxs {
+			segs = append(segs, pathSeg{idx: n, isIx: true})
+		}
+	}
+	return segs
+}
+
+// parsePredicate parses the body of a `[?...]` attribute predicate,
+// supporting "==", "!=", "=~", "<", ">", "&&", and "||", left-associative
+// with "&&" binding tighter than "||".
+func parsePredicate(body string) (predicateExpr, error) {
+	p := &predicateParser{input: body}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.input) {
+		return nil, fmt.Errorf("unexpected trailing input %q", p.input[p.pos:])
+	}
+	return expr, nil
+}
+
+type predicateParser struct {
+	input string
+	pos   int
+}
+
+func (p *predicateParser) skipSpace() {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *predicateParser) parseOr() (predicateExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if !strings.HasPrefix(p.input[p.pos:], "||") {
+			return left, nil
+		}
+		p.pos += 2
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left: left, right: right}
+	}
+}
+
+func (p *predicateParser) parseAnd() (predicateExpr, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if !strings.HasPrefix(p.input[p.pos:], "&&") {
+			return left, nil
+		}
+		p.pos += 2
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left: left, right: right}
+	}
+}
+
+var predicateOps = []string{"==", "!=", "=~", "<", ">"}
+
+func (p *predicateParser) parseComparison() (predicateExpr, error) {
+	p.skipSpace()
+	path, err := p.parseToken()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+	var op string
+	for _, candidate := range predicateOps {
+		if strings.HasPrefix(p.input[p.pos:], candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return nil, fmt.Errorf("expected a comparison operator after %q", path)
+	}
+	p.pos += len(op)
+
+	p.skipSpace()
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	expr := compareExpr{path: path, op: op, value: value}
+	if op == "=~" {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %s", value, err)
+		}
+		expr.re = re
+	}
+	return expr, nil
+}
+
+func (p *predicateParser) parseToken() (string, error) {
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		if c == ' ' || c == '=' || c == '!' || c == '<' || c == '>' {
+			break
+		}
+		p.pos++
+	}
+	if p.pos == start {
+		return "", fmt.Errorf("expected an attribute path at position %d", start)
+	}
+	return p.input[start:p.pos], nil
+}
+
+func (p *predicateParser) parseValue() (string, error) {
+	if p.pos < len(p.input) && p.input[p.pos] == '"' {
+		end := strings.IndexByte(p.input[p.pos+1:], '"')
+		if end == -1 {
+			return "", fmt.Errorf("unterminated string literal")
+		}
+		value := p.input[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return value, nil
+	}
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		if c == ' ' || strings.HasPrefix(p.input[p.pos:], "&&") || strings.HasPrefix(p.input[p.pos:], "||") {
+			break
+		}
+		p.pos++
+	}
+	if p.pos == start {
+		return "", fmt.Errorf("expected a value at position %d", start)
+	}
+	return p.input[start:p.pos], nil
+}
+
+// decodeAttrs decodes a resource instance's current AttrsJSON, returning an
+// empty map (rather than an error) when attrsJSON is empty, so that every
+// attribute lookup against it simply fails to resolve.
+func decodeAttrs(attrsJSON []byte) (map[string]interface{}, error) {
+	attrs := make(map[string]interface{})
+	if len(attrsJSON) == 0 {
+		return attrs, nil
+	}
+	if err := json.Unmarshal(attrsJSON, &attrs); err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
@@ -0,0 +1,321 @@
+package terraform
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/states"
+)
+
+// testFilterState builds a state that exercises exact addresses, glob
+// wildcards, instance key ranges, module instance keys, and attribute
+// predicates: a couple of root-module resources with distinct attributes,
+// a set of int-keyed instances, a string-keyed instance, and resources in
+// both a plain child module and a "for_each" module instance.
+func testFilterState() *states.State {
+	return states.BuildState(func(s *states.SyncState) {
+		setInstance := func(mod addrs.ModuleInstance, typeName, name string, key addrs.InstanceKey, attrsJSON string) {
+			s.SetResourceInstanceCurrent(
+				addrs.Resource{
+					Mode: addrs.ManagedResourceMode,
+					Type: typeName,
+					Name: name,
+				}.Instance(key).Absolute(mod),
+				&states.ResourceInstanceObjectSrc{
+					Status:    states.ObjectReady,
+					AttrsJSON: []byte(attrsJSON),
+				},
+				addrs.AbsProviderConfig{
+					Provider: addrs.NewDefaultProvider("aws"),
+					Module:   addrs.RootModule,
+				},
+			)
+		}
+
+		setInstance(addrs.RootModuleInstance, "aws_instance", "web", addrs.NoKey,
+			`{"id":"web-id","tags":{"Env":"prod","Team":"payments"}}`)
+		setInstance(addrs.RootModuleInstance, "aws_instance", "db", addrs.NoKey,
+			`{"id":"db-id","tags":{"Env":"dev"}}`)
+
+		for i := 0; i < 5; i++ {
+			setInstance(addrs.RootModuleInstance, "aws_instance", "cluster", addrs.IntKey(i),
+				fmt.Sprintf(`{"id":"cluster-%d"}`, i))
+		}
+		setInstance(addrs.RootModuleInstance, "aws_instance", "named", addrs.StringKey("prod-a"),
+			`{"id":"named-prod-a"}`)
+
+		child, _ := addrs.ParseModuleInstanceStr("module.child")
+		setInstance(child, "aws_instance", "web", addrs.NoKey, `{"id":"child-web-id"}`)
+
+		worker0, _ := addrs.ParseModuleInstanceStr(`module.worker[0]`)
+		worker1, _ := addrs.ParseModuleInstanceStr(`module.worker[1]`)
+		setInstance(worker0, "aws_instance", "task", addrs.NoKey, `{"id":"worker0-task"}`)
+		setInstance(worker1, "aws_instance", "task", addrs.NoKey, `{"id":"worker1-task"}`)
+	})
+}
+
+func testFilterAddrs(t *testing.T, f *StateFilter, args ...string) []string {
+	t.Helper()
+	results, err := f.Filter(args...)
+	if err != nil {
+		t.Fatalf("Filter(%v) returned error: %s", args, err)
+	}
+	var addrsOut []string
+	for _, r := range results {
+		if _, ok := r.Value.(*states.ResourceInstance); ok {
+			addrsOut = append(addrsOut, r.Address)
+		}
+	}
+	sort.Strings(addrsOut)
+	return addrsOut
+}
+
+func TestStateFilter_exactMatchParity(t *testing.T) {
+	f := &StateFilter{State: testFilterState()}
+
+	// A resource address without a module prefix matches that resource in
+	// every module, as it always has.
+	got := testFilterAddrs(t, f, "aws_instance.web")
+	want := []string{"aws_instance.web", "module.child.aws_instance.web"}
+	if !stringSlicesEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	got = testFilterAddrs(t, f, "module.child.aws_instance.web")
+	want = []string{"module.child.aws_instance.web"}
+	if !stringSlicesEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestStateFilter_globs(t *testing.T) {
+	f := &StateFilter{State: testFilterState()}
+
+	got := testFilterAddrs(t, f, "aws_instance.*")
+	want := []string{
+		"aws_instance.cluster[0]",
+		"aws_instance.cluster[1]",
+		"aws_instance.cluster[2]",
+		"aws_instance.cluster[3]",
+		"aws_instance.cluster[4]",
+		"aws_instance.db",
+		`aws_instance.named["prod-a"]`,
+		"aws_instance.web",
+	}
+	if !stringSlicesEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	got = testFilterAddrs(t, f, "module.*.aws_instance.*")
+	want = []string{
+		"module.child.aws_instance.web",
+		"module.worker[0].aws_instance.task",
+		"module.worker[1].aws_instance.task",
+	}
+	if !stringSlicesEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestStateFilter_keyRange(t *testing.T) {
+	f := &StateFilter{State: testFilterState()}
+
+	got := testFilterAddrs(t, f, "aws_instance.cluster[1-3]")
+	want := []string{
+		"aws_instance.cluster[1]",
+		"aws_instance.cluster[2]",
+		"aws_instance.cluster[3]",
+	}
+	if !stringSlicesEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	got = testFilterAddrs(t, f, `aws_instance.named["prod-*"]`)
+	want = []string{`aws_instance.named["prod-a"]`}
+	if !stringSlicesEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestStateFilter_moduleInstanceKey(t *testing.T) {
+	f := &StateFilter{State: testFilterState()}
+
+	got := testFilterAddrs(t, f, "module.worker[0].aws_instance.task")
+	want := []string{"module.worker[0].aws_instance.task"}
+	if !stringSlicesEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// A module instance key restricts to only that instance, not every
+	// instance of the module -- the bug this pattern regressed on.
+	got = testFilterAddrs(t, f, "module.worker[1].aws_instance.*")
+	want = []string{"module.worker[1].aws_instance.task"}
+	if !stringSlicesEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestStateFilter_predicates(t *testing.T) {
+	f := &StateFilter{State: testFilterState()}
+
+	cases := []struct {
+		pattern string
+		want    []string
+	}{
+		{`aws_instance.*[?id=="web-id"]`, []string{"aws_instance.web"}},
+		{`aws_instance.*[?tags.Env=="prod"]`, []string{"aws_instance.web"}},
+		{`aws_instance.*[?tags.Env!="prod"]`, []string{"aws_instance.db"}},
+		{`aws_instance.*[?id=~"^cluster-[0-2]$"]`, []string{
+			"aws_instance.cluster[0]", "aws_instance.cluster[1]", "aws_instance.cluster[2]",
+		}},
+		{`aws_instance.*[?tags.Env=="prod" && tags.Team=="payments"]`, []string{"aws_instance.web"}},
+		{`aws_instance.*[?tags.Env=="prod" || tags.Env=="dev"]`, []string{"aws_instance.db", "aws_instance.web"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.pattern, func(t *testing.T) {
+			got := testFilterAddrs(t, f, tc.pattern)
+			if !stringSlicesEqual(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStateFilter_predicateComparisons(t *testing.T) {
+	attrs := map[string]interface{}{
+		"id":    "abc",
+		"count": float64(3),
+		"tags":  map[string]interface{}{"Env": "prod"},
+	}
+
+	cases := []struct {
+		expr predicateExpr
+		want bool
+	}{
+		{compareExpr{path: "id", op: "==", value: "abc"}, true},
+		{compareExpr{path: "id", op: "!=", value: "abc"}, false},
+		{compareExpr{path: "count", op: "<", value: "5"}, true},
+		{compareExpr{path: "count", op: ">", value: "5"}, false},
+		{andExpr{compareExpr{path: "id", op: "==", value: "abc"}, compareExpr{path: "tags.Env", op: "==", value: "prod"}}, true},
+		{orExpr{compareExpr{path: "id", op: "==", value: "nope"}, compareExpr{path: "tags.Env", op: "==", value: "prod"}}, true},
+	}
+
+	for _, tc := range cases {
+		got, err := tc.expr.Eval(attrs)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got != tc.want {
+			t.Fatalf("Eval(%#v) = %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestParsePattern_errors(t *testing.T) {
+	cases := []string{
+		"aws_instance",
+		"aws_instance.web[",
+		`aws_instance.web[?id=]`,
+		`aws_instance.web[?id=="unterminated]`,
+		`module.foo[bogus].aws_instance.web`,
+	}
+
+	for _, raw := range cases {
+		t.Run(raw, func(t *testing.T) {
+			if _, err := compileFilterArg(raw); err == nil {
+				t.Fatalf("expected an error parsing %q, got none", raw)
+			}
+		})
+	}
+}
+
+func TestStateFilter_idSugarComposesWithPatterns(t *testing.T) {
+	// Regression test for the "-id" sugar: combining an id lookup with a
+	// pattern that already has a bracketed suffix must not be spliced as
+	// raw text (which used to produce an invalid double-bracketed pattern).
+	f := &StateFilter{State: testFilterState()}
+
+	matched, err := f.Filter("aws_instance.cluster[0-4]")
+	if err != nil {
+		t.Fatalf("Filter returned error: %s", err)
+	}
+
+	byID := make(map[string]bool)
+	for _, r := range f.ResultsWithID("cluster-2") {
+		byID[r.Address] = true
+	}
+
+	var got []string
+	for _, r := range matched {
+		if byID[r.Address] {
+			got = append(got, r.Address)
+		}
+	}
+	want := []string{"aws_instance.cluster[2]"}
+	if !stringSlicesEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestStateFilter_reset(t *testing.T) {
+	state := testFilterState()
+	f := &StateFilter{State: state}
+
+	if got := testFilterAddrs(t, f, "aws_instance.web"); !stringSlicesEqual(got, []string{"aws_instance.web", "module.child.aws_instance.web"}) {
+		t.Fatalf("got %v", got)
+	}
+
+	// Mutate the state and Reset the filter; without Reset, Filter would
+	// still be consulting the stale pre-mutation index.
+	state.SyncWrapper().SetResourceInstanceCurrent(
+		addrs.Resource{Mode: addrs.ManagedResourceMode, Type: "aws_instance", Name: "added"}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance),
+		&states.ResourceInstanceObjectSrc{Status: states.ObjectReady, AttrsJSON: []byte(`{"id":"added-id"}`)},
+		addrs.AbsProviderConfig{Provider: addrs.NewDefaultProvider("aws"), Module: addrs.RootModule},
+	)
+	f.Reset()
+
+	got := testFilterAddrs(t, f, "aws_instance.added")
+	want := []string{"aws_instance.added"}
+	if !stringSlicesEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestStateFilter_concurrentFilter(t *testing.T) {
+	f := &StateFilter{State: testFilterState()}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := f.Filter("aws_instance.*"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("concurrent Filter returned error: %s", err)
+	}
+}
+
+func stringSlicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}